@@ -0,0 +1,193 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loopclosure
+
+import (
+	"go/ast"
+	"go/types"
+
+	"golang.org/x/tools/go/analysis/passes/internal/analysisutil"
+)
+
+// deepFlag enables a lightweight intra-loop dataflow pass that looks past
+// the last statement of the loop body: a go, defer, errgroup.Group.Go, or
+// context.AfterFunc earlier in the body is only reported if nothing later
+// in the same loop body synchronizes with it (a sync.WaitGroup.Wait, an
+// errgroup.Group.Wait, a channel receive, or a call to the stop function
+// returned by context.AfterFunc). Without -deep, such a launch is assumed
+// to be followed by a synchronizing call and is not reported unless it is
+// the last statement in the loop body.
+var deepFlag bool
+
+func init() {
+	Analyzer.Flags.BoolVar(&deepFlag, "deep", false, "check for captures by goroutines launched before the end of the loop body, suppressing the diagnostic only if a later statement synchronizes with the launch")
+}
+
+// launchKind identifies how a launch statement can be synchronized with.
+type launchKind int
+
+const (
+	launchWaitGroup launchKind = iota
+	launchErrgroup
+	launchChannel
+	launchStopFunc
+)
+
+// contextAfterFuncEscape describes context.AfterFunc's escaping argument, so
+// that deep mode can recognize it independently of the user-extensible
+// escapeFuncs table used by goInvoke.
+var contextAfterFuncEscape = escapeFunc{pkgPath: "context", method: "AfterFunc", argIndex: 1}
+
+// launch records a goroutine-launching statement found in a loop body,
+// along with the primitive (if any) that a later statement could use to
+// synchronize with it.
+type launch struct {
+	index    int
+	kind     launchKind
+	receiver types.Object // nil if no synchronizing primitive was found
+}
+
+// computeSynced returns the set of statement indices in body whose launch is
+// synchronized by some later statement in body.
+func computeSynced(info *types.Info, body *ast.BlockStmt) map[int]bool {
+	var launches []launch
+	for i, s := range body.List {
+		switch s := s.(type) {
+		case *ast.GoStmt:
+			if lit, ok := s.Call.Fun.(*ast.FuncLit); ok {
+				launches = append(launches, launchFor(info, i, lit))
+			}
+		case *ast.DeferStmt:
+			if lit, ok := s.Call.Fun.(*ast.FuncLit); ok {
+				launches = append(launches, launchFor(info, i, lit))
+			}
+		case *ast.ExprStmt:
+			if call, ok := s.X.(*ast.CallExpr); ok {
+				if r, ok := errgroupGoReceiver(info, call); ok {
+					launches = append(launches, launch{i, launchErrgroup, r})
+				}
+			}
+		case *ast.AssignStmt:
+			// stop := context.AfterFunc(ctx, func() { ... })
+			if len(s.Lhs) == 1 && len(s.Rhs) == 1 {
+				if call, ok := s.Rhs[0].(*ast.CallExpr); ok && contextAfterFuncEscape.matches(info, call) {
+					if id, ok := s.Lhs[0].(*ast.Ident); ok {
+						launches = append(launches, launch{i, launchStopFunc, info.ObjectOf(id)})
+					}
+				}
+			}
+		}
+	}
+
+	synced := map[int]bool{}
+	for _, l := range launches {
+		if l.receiver == nil {
+			continue
+		}
+		for _, s := range body.List[l.index+1:] {
+			if synchronizes(info, s, l) {
+				synced[l.index] = true
+				break
+			}
+		}
+	}
+	return synced
+}
+
+// launchFor determines the synchronizing primitive (if any) used by the
+// function literal passed to a go or defer statement: either a
+// "defer wg.Done()"-style call on a sync.WaitGroup, or a send on a channel.
+func launchFor(info *types.Info, index int, lit *ast.FuncLit) launch {
+	l := launch{index: index, kind: launchWaitGroup}
+	ast.Inspect(lit.Body, func(n ast.Node) bool {
+		if l.receiver != nil {
+			return false
+		}
+		switch n := n.(type) {
+		case *ast.CallExpr:
+			if analysisutil.IsMethodCall(info, n, "sync", "WaitGroup", "Done") {
+				l.receiver = receiverObject(info, n)
+			}
+		case *ast.SendStmt:
+			if id, ok := n.Chan.(*ast.Ident); ok {
+				l.kind = launchChannel
+				l.receiver = info.ObjectOf(id)
+			}
+		}
+		return true
+	})
+	return l
+}
+
+// errgroupGoReceiver reports whether call is an invocation of
+// errgroup.Group.Go or TryGo, returning the errgroup.Group receiver object.
+func errgroupGoReceiver(info *types.Info, call *ast.CallExpr) (types.Object, bool) {
+	if !analysisutil.IsMethodCall(info, call, "golang.org/x/sync/errgroup", "Group", "Go") &&
+		!analysisutil.IsMethodCall(info, call, "golang.org/x/sync/errgroup", "Group", "TryGo") {
+		return nil, false
+	}
+	return receiverObject(info, call), true
+}
+
+// receiverObject returns the types.Object of a method call's receiver
+// expression, if it is a plain identifier.
+func receiverObject(info *types.Info, call *ast.CallExpr) types.Object {
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok {
+		return nil
+	}
+	id, ok := sel.X.(*ast.Ident)
+	if !ok {
+		return nil
+	}
+	return info.ObjectOf(id)
+}
+
+// synchronizes reports whether s synchronizes with l: a call to Wait() on
+// l's receiver (for a WaitGroup or errgroup.Group launch), a receive
+// from l's receiver channel (for a channel-send launch), or a call to l's
+// receiver (for the stop function returned by context.AfterFunc).
+func synchronizes(info *types.Info, s ast.Stmt, l launch) bool {
+	found := false
+	ast.Inspect(s, func(n ast.Node) bool {
+		if found {
+			return false
+		}
+		switch l.kind {
+		case launchWaitGroup:
+			if call, ok := n.(*ast.CallExpr); ok && analysisutil.IsMethodCall(info, call, "sync", "WaitGroup", "Wait") {
+				if receiverObject(info, call) == l.receiver {
+					found = true
+					return false
+				}
+			}
+		case launchErrgroup:
+			if call, ok := n.(*ast.CallExpr); ok && analysisutil.IsMethodCall(info, call, "golang.org/x/sync/errgroup", "Group", "Wait") {
+				if receiverObject(info, call) == l.receiver {
+					found = true
+					return false
+				}
+			}
+		case launchChannel:
+			if unary, ok := n.(*ast.UnaryExpr); ok && unary.Op.String() == "<-" {
+				if id, ok := unary.X.(*ast.Ident); ok && info.ObjectOf(id) == l.receiver {
+					found = true
+					return false
+				}
+			}
+		case launchStopFunc:
+			// A call to the stop function returned by context.AfterFunc,
+			// e.g. "stop()".
+			if call, ok := n.(*ast.CallExpr); ok {
+				if id, ok := call.Fun.(*ast.Ident); ok && info.ObjectOf(id) == l.receiver {
+					found = true
+					return false
+				}
+			}
+		}
+		return true
+	})
+	return found
+}
@@ -0,0 +1,169 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loopclosure
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/analysis/passes/internal/analysisutil"
+	"golang.org/x/tools/go/types/typeutil"
+)
+
+// An escapeFunc describes a function or method whose call is known to
+// invoke one of its arguments asynchronously, such that the argument may
+// still be running after the call returns.
+type escapeFunc struct {
+	pkgPath  string // import path, e.g. "golang.org/x/sync/errgroup"
+	typeName string // receiver type name, or "" for a package-level function
+	method   string // method or function name
+	argIndex int    // index of the escaping function argument
+}
+
+// escapeFuncs is the built-in table of recognized escaping calls.
+var escapeFuncs = []escapeFunc{
+	{"golang.org/x/sync/errgroup", "Group", "Go", 0},
+	{"golang.org/x/sync/errgroup", "Group", "TryGo", 0},
+	{"golang.org/x/sync/singleflight", "Group", "Do", 1},
+	{"golang.org/x/sync/singleflight", "Group", "DoChan", 1},
+	{"context", "", "AfterFunc", 1},
+	{"time", "", "AfterFunc", 1},
+}
+
+// escapeFuncsFlag holds additional user-supplied entries, in the form
+// "pkg.Type.Method:argN" or "pkg.Method:argN" for a package-level function,
+// separated by commas. It implements flag.Value so that a malformed entry
+// is rejected (with an error) when the flag is set, rather than silently
+// discarded.
+var escapeFuncsFlag escapeFuncsValue
+
+// escapeFuncsValue is the flag.Value backing -escape-funcs.
+type escapeFuncsValue struct {
+	raw    string
+	parsed []escapeFunc
+}
+
+func (v *escapeFuncsValue) String() string {
+	if v == nil {
+		return ""
+	}
+	return v.raw
+}
+
+func (v *escapeFuncsValue) Set(s string) error {
+	parsed, err := parseEscapeFuncs(s)
+	if err != nil {
+		return err
+	}
+	v.raw = s
+	v.parsed = parsed
+	return nil
+}
+
+// matches reports whether call is an invocation of e.
+func (e escapeFunc) matches(info *types.Info, call *ast.CallExpr) bool {
+	f := typeutil.StaticCallee(info, call)
+	if f == nil || f.Name() != e.method {
+		return false
+	}
+	sig := f.Type().(*types.Signature)
+	if e.typeName == "" {
+		if sig.Recv() != nil {
+			return false
+		}
+		pkg := f.Pkg()
+		return pkg != nil && pkg.Path() == e.pkgPath
+	}
+	recv := sig.Recv()
+	if recv == nil {
+		return false
+	}
+	return analysisutil.IsNamedType(recv.Type(), e.pkgPath, e.typeName)
+}
+
+// goInvoke returns a function expression that would be called asynchronously
+// (but not awaited) in another goroutine as a consequence of the call.
+// For example, given the g.Go call below, it returns the function literal expression.
+//
+//	import "sync/errgroup"
+//	var g errgroup.Group
+//	g.Go(func() error { ... })
+//
+// The set of recognized functions is given by escapeFuncs, plus any entries
+// supplied via the -escape-funcs flag.
+func goInvoke(info *types.Info, call *ast.CallExpr) ast.Expr {
+	for _, e := range parsedEscapeFuncs() {
+		if e.matches(info, call) && e.argIndex < len(call.Args) {
+			return call.Args[e.argIndex]
+		}
+	}
+	return nil
+}
+
+// parsedEscapeFuncs returns the built-in escapeFuncs table, extended with
+// any entries parsed from escapeFuncsFlag. escapeFuncsValue.Set validates
+// entries when the flag is set, so there is nothing left to parse here.
+func parsedEscapeFuncs() []escapeFunc {
+	if len(escapeFuncsFlag.parsed) == 0 {
+		return escapeFuncs
+	}
+	return append(append([]escapeFunc(nil), escapeFuncs...), escapeFuncsFlag.parsed...)
+}
+
+// parseEscapeFuncs parses a comma-separated list of entries of the form
+// "pkg.Type.Method:argN" or "pkg.Method:argN".
+func parseEscapeFuncs(s string) ([]escapeFunc, error) {
+	var funcs []escapeFunc
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		ef, err := parseEscapeFunc(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -escape-funcs entry %q: %v", entry, err)
+		}
+		funcs = append(funcs, ef)
+	}
+	return funcs, nil
+}
+
+func parseEscapeFunc(entry string) (escapeFunc, error) {
+	name, argStr, ok := cut(entry, ":")
+	if !ok {
+		return escapeFunc{}, fmt.Errorf("missing \":argN\" suffix")
+	}
+	argIndex, err := strconv.Atoi(argStr)
+	if err != nil {
+		return escapeFunc{}, fmt.Errorf("invalid argument index %q: %v", argStr, err)
+	}
+
+	dot := strings.LastIndex(name, ".")
+	if dot < 0 {
+		return escapeFunc{}, fmt.Errorf("expected pkg.Method or pkg.Type.Method")
+	}
+	method := name[dot+1:]
+	rest := name[:dot]
+
+	pkgPath, typeName := rest, ""
+	if slash := strings.LastIndex(rest, "/"); strings.Contains(rest[slash+1:], ".") {
+		d := strings.LastIndex(rest, ".")
+		pkgPath, typeName = rest[:d], rest[d+1:]
+	}
+
+	return escapeFunc{pkgPath: pkgPath, typeName: typeName, method: method, argIndex: argIndex}, nil
+}
+
+// cut is strings.Cut, reimplemented for compatibility with Go versions
+// before 1.18.
+func cut(s, sep string) (before, after string, found bool) {
+	if i := strings.Index(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
@@ -7,14 +7,15 @@
 package loopclosure
 
 import (
+	"fmt"
 	"go/ast"
+	"go/token"
 	"go/types"
 
 	"golang.org/x/tools/go/analysis"
 	"golang.org/x/tools/go/analysis/passes/inspect"
+	"golang.org/x/tools/go/analysis/passes/internal/analysisutil"
 	"golang.org/x/tools/go/ast/inspector"
-	"golang.org/x/tools/go/types/typeutil"
-	"golang.org/x/tools/internal/analysisinternal"
 )
 
 const Doc = `check references to loop variables from within nested functions
@@ -23,11 +24,24 @@ This analyzer checks for references to loop variables from within a function
 literal inside the loop body. It checks for patterns where access to a loop
 variable is known to escape the current loop iteration:
  1. a call to go or defer at the end of the loop body
- 2. a call to golang.org/x/sync/errgroup.Group.Go at the end of the loop body
+ 2. a call, at the end of the loop body, to a function known to invoke one
+    of its arguments asynchronously, such as
+    golang.org/x/sync/errgroup.Group.Go, errgroup.Group.TryGo,
+    golang.org/x/sync/singleflight.Group.Do/DoChan, context.AfterFunc, and
+    time.AfterFunc. Use the -escape-funcs flag to teach the analyzer about
+    additional functions of this kind.
+ 3. a call to testing.T.Run where the subtest body invokes t.Parallel(), in
+    which case only references after the t.Parallel() call are reported,
+    since statements before it still run synchronously with the loop.
 
-The analyzer only considers references in the last statement of the loop body
-as it is not deep enough to understand the effects of subsequent statements
-which might render the reference benign.
+By default, the analyzer only considers go, defer, and escape-func references
+in the last statement of the loop body, as it is not deep enough to
+understand the effects of subsequent statements which might render the
+reference benign. Pass -deep to additionally consider such references
+earlier in the loop body, suppressing the diagnostic only when a later
+statement in the same loop body synchronizes with the launch (a
+sync.WaitGroup.Wait, an errgroup.Group.Wait, a channel receive, or a call
+to the stop function returned by context.AfterFunc).
 
 For example:
 
@@ -39,10 +53,6 @@ For example:
 
 See: https://golang.org/doc/go_faq.html#closures_and_goroutines`
 
-// TODO(rfindley): enable support for checking parallel subtests, pending
-// investigation, adding:
-// 3. a call testing.T.Run where the subtest body invokes t.Parallel()
-
 var Analyzer = &analysis.Analyzer{
 	Name:     "loopclosure",
 	Doc:      Doc,
@@ -50,6 +60,10 @@ var Analyzer = &analysis.Analyzer{
 	Run:      run,
 }
 
+func init() {
+	Analyzer.Flags.Var(&escapeFuncsFlag, "escape-funcs", "comma-separated list of additional pkg.Type.Method:argN (or pkg.Method:argN) entries recognized as asynchronous escaping calls")
+}
+
 func run(pass *analysis.Pass) (interface{}, error) {
 	inspect := pass.ResultOf[inspect.Analyzer].(*inspector.Inspector)
 
@@ -91,36 +105,115 @@ func run(pass *analysis.Pass) (interface{}, error) {
 		// Inspect statements to find function literals that may be run outside of
 		// the current loop iteration.
 		//
-		// For go, defer, and errgroup.Group.Go, we ignore all but the last
-		// statement, because it's hard to prove go isn't followed by wait, or
-		// defer by return.
+		// For go, defer, and escaping calls (see goInvoke), we ignore all but the last
+		// statement by default, because it's hard to prove go isn't followed by
+		// wait, or defer by return. With -deep, earlier statements are also
+		// considered, unless a later statement in the same loop body
+		// synchronizes with them; see computeSynced.
 		//
 		// We consider every t.Run statement in the loop body, because there is
 		// no such commonly used mechanism for synchronizing parallel subtests.
 		// It is of course theoretically possible to synchronize parallel subtests,
 		// though such a pattern is likely to be exceedingly rare as it would be
 		// fighting against the test runner.
+		// reportCaptures reports each reference within n to a captured loop
+		// variable. rebindAt is the position at which a "v := v" statement
+		// would rebind the variable to a fresh copy before it escapes;
+		// fixed tracks which variables already got a suggested fix so that
+		// multiple references to the same variable in the same scope don't
+		// each propose their own (redundant) rebinding edit.
+		reportCaptures := func(n ast.Node, rebindAt token.Pos, fixed map[*ast.Object]bool) {
+			ast.Inspect(n, func(n ast.Node) bool {
+				id, ok := n.(*ast.Ident)
+				if !ok || id.Obj == nil {
+					return true
+				}
+				if pass.TypesInfo.Types[id].Type == nil {
+					// Not referring to a variable (e.g. struct field name)
+					return true
+				}
+				for _, v := range vars {
+					if v.Obj != id.Obj {
+						continue
+					}
+					diag := analysis.Diagnostic{
+						Pos:     id.Pos(),
+						End:     id.End(),
+						Message: fmt.Sprintf("loop variable %s captured by func literal", id.Name),
+					}
+					if !fixed[v.Obj] {
+						fixed[v.Obj] = true
+						diag.SuggestedFixes = []analysis.SuggestedFix{{
+							Message: fmt.Sprintf("Rebind %s to a new variable", v.Name),
+							TextEdits: []analysis.TextEdit{{
+								Pos:     rebindAt,
+								End:     rebindAt,
+								NewText: []byte(fmt.Sprintf("%s := %s\n", v.Name, v.Name)),
+							}},
+						}}
+					}
+					pass.Report(diag)
+				}
+				return true
+			})
+		}
+
 		lastStmt := len(body.List) - 1
+		var synced map[int]bool
+		if deepFlag {
+			synced = computeSynced(pass.TypesInfo, body)
+		}
+		// escapes reports whether the statement at index i is treated as
+		// escaping the loop iteration: without -deep, only the last
+		// statement is considered; with -deep, any go, defer, or escaping
+		// call recognized by goInvoke that is not synchronized by a later
+		// statement is considered as well.
+		escapes := func(i int) bool {
+			return i == lastStmt || (deepFlag && !synced[i])
+		}
+
 		for i, s := range body.List {
 			var fun ast.Expr // if non-nil, a function that escapes the loop iteration
 			switch s := s.(type) {
 			case *ast.GoStmt:
-				if i == lastStmt {
+				if escapes(i) {
 					fun = s.Call.Fun
 				}
 
 			case *ast.DeferStmt:
-				if i == lastStmt {
+				if escapes(i) {
 					fun = s.Call.Fun
 				}
 
+			case *ast.AssignStmt: // e.g. stop := context.AfterFunc(ctx, func() { ... })
+				if len(s.Rhs) == 1 && escapes(i) {
+					if call, ok := s.Rhs[0].(*ast.CallExpr); ok {
+						fun = goInvoke(pass.TypesInfo, call)
+					}
+				}
+
 			case *ast.ExprStmt: // check for errgroup.Group.Go and testing.T.Run (with T.Parallel)
 				if call, ok := s.X.(*ast.CallExpr); ok {
-					if i == lastStmt {
+					if escapes(i) {
 						fun = goInvoke(pass.TypesInfo, call)
 					}
-					if fun == nil && analysisinternal.LoopclosureParallelSubtests {
-						fun = parallelSubtest(pass.TypesInfo, call)
+					if fun == nil {
+						if lit, parallelIndex := parallelSubtest(pass.TypesInfo, call); lit != nil {
+							// Only statements that run after t.Parallel() execute
+							// outside of the current loop iteration; statements
+							// before it still run synchronously (e.g. a `tc := tc`
+							// rebinding prior to t.Parallel()).
+							//
+							// Since the subtest's closure receives its own *testing.T,
+							// the rebinding has to happen in the loop body, before the
+							// t.Run call, rather than inside the closure.
+							fixed := map[*ast.Object]bool{}
+							rebindAt := s.Pos()
+							for _, stmt := range lit.Body.List[parallelIndex+1:] {
+								reportCaptures(stmt, rebindAt, fixed)
+							}
+						}
+						continue
 					}
 				}
 			}
@@ -129,48 +222,22 @@ func run(pass *analysis.Pass) (interface{}, error) {
 			if !ok {
 				continue
 			}
-
-			ast.Inspect(lit.Body, func(n ast.Node) bool {
-				id, ok := n.(*ast.Ident)
-				if !ok || id.Obj == nil {
-					return true
-				}
-				if pass.TypesInfo.Types[id].Type == nil {
-					// Not referring to a variable (e.g. struct field name)
-					return true
-				}
-				for _, v := range vars {
-					if v.Obj == id.Obj {
-						pass.ReportRangef(id, "loop variable %s captured by func literal",
-							id.Name)
-					}
-				}
-				return true
-			})
+			// Rebind as the first statement of the closure.
+			rebindAt := lit.Body.Lbrace + 1
+			if len(lit.Body.List) > 0 {
+				rebindAt = lit.Body.List[0].Pos()
+			}
+			reportCaptures(lit.Body, rebindAt, map[*ast.Object]bool{})
 		}
 	})
 	return nil, nil
 }
 
-// goInvoke returns a function expression that would be called asynchronously
-// (but not awaited) in another goroutine as a consequence of the call.
-// For example, given the g.Go call below, it returns the function literal expression.
-//
-//	import "sync/errgroup"
-//	var g errgroup.Group
-//	g.Go(func() error { ... })
-//
-// Currently only "golang.org/x/sync/errgroup.Group()" is considered.
-func goInvoke(info *types.Info, call *ast.CallExpr) ast.Expr {
-	if !isMethodCall(info, call, "golang.org/x/sync/errgroup", "Group", "Go") {
-		return nil
-	}
-	return call.Args[0]
-}
-
-// parallelSubtest returns a function expression that would be called
-// asynchronously via the go test runner, as t.Run has been invoked with a
-// function literal that calls t.Parallel.
+// parallelSubtest returns the function literal passed to t.Run, along with
+// the index within its body of the call to t.Parallel, if t.Run has been
+// invoked with a function literal that calls t.Parallel. References to the
+// enclosing loop variables are only a bug if they occur after this index, as
+// statements before it still execute synchronously with the loop.
 //
 //		import "testing"
 //
@@ -183,67 +250,25 @@ func goInvoke(info *types.Info, call *ast.CallExpr) ast.Expr {
 //			 	})
 //		 	}
 //		}
-func parallelSubtest(info *types.Info, call *ast.CallExpr) ast.Expr {
-	if !isMethodCall(info, call, "testing", "T", "Run") {
-		return nil
+func parallelSubtest(info *types.Info, call *ast.CallExpr) (*ast.FuncLit, int) {
+	if !analysisutil.IsMethodCall(info, call, "testing", "T", "Run") {
+		return nil, -1
 	}
 
 	lit, ok := call.Args[1].(*ast.FuncLit)
 	if !ok {
-		return nil
+		return nil, -1
 	}
 
-	for _, stmt := range lit.Body.List {
+	for i, stmt := range lit.Body.List {
 		exprStmt, ok := stmt.(*ast.ExprStmt)
 		if !ok {
 			continue
 		}
-		if isMethodCall(info, exprStmt.X, "testing", "T", "Parallel") {
-			return lit
+		if analysisutil.IsMethodCall(info, exprStmt.X, "testing", "T", "Parallel") {
+			return lit, i
 		}
 	}
 
-	return nil
-}
-
-// isMethodCall reports whether expr is a method call of
-// <pkgPath>.<typeName>.<method>.
-func isMethodCall(info *types.Info, expr ast.Expr, pkgPath, typeName, method string) bool {
-	call, ok := expr.(*ast.CallExpr)
-	if !ok {
-		return false
-	}
-
-	// Check that we are calling a method <method>
-	f := typeutil.StaticCallee(info, call)
-	if f == nil || f.Name() != method {
-		return false
-	}
-	recv := f.Type().(*types.Signature).Recv()
-	if recv == nil {
-		return false
-	}
-
-	// Check that the receiver is a <pkgPath>.<typeName> or
-	// *<pkgPath>.<typeName>.
-	rtype := recv.Type()
-	if ptr, ok := recv.Type().(*types.Pointer); ok {
-		rtype = ptr.Elem()
-	}
-	named, ok := rtype.(*types.Named)
-	if !ok {
-		return false
-	}
-	if named.Obj().Name() != typeName {
-		return false
-	}
-	pkg := f.Pkg()
-	if pkg == nil {
-		return false
-	}
-	if pkg.Path() != pkgPath {
-		return false
-	}
-
-	return true
+	return nil, -1
 }
@@ -0,0 +1,47 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loopclosure_test
+
+import (
+	"testing"
+
+	"golang.org/x/tools/go/analysis/analysistest"
+	"golang.org/x/tools/go/analysis/passes/loopclosure"
+)
+
+func Test(t *testing.T) {
+	testdata := analysistest.TestData()
+	analysistest.Run(t, testdata, loopclosure.Analyzer, "a")
+}
+
+func TestSuggestedFixes(t *testing.T) {
+	testdata := analysistest.TestData()
+	analysistest.RunWithSuggestedFixes(t, testdata, loopclosure.Analyzer, "d", "e")
+}
+
+func TestEscapeFuncsFlag(t *testing.T) {
+	testdata := analysistest.TestData()
+	if err := loopclosure.Analyzer.Flags.Set("escape-funcs", "c.Pool.Submit:0"); err != nil {
+		t.Fatal(err)
+	}
+	defer loopclosure.Analyzer.Flags.Set("escape-funcs", "")
+	analysistest.Run(t, testdata, loopclosure.Analyzer, "c")
+}
+
+func TestEscapeFuncsFlagRejectsMalformedEntry(t *testing.T) {
+	if err := loopclosure.Analyzer.Flags.Set("escape-funcs", "c.Pool.Submit"); err == nil {
+		t.Fatal("Set with a missing \":argN\" suffix should have failed")
+	}
+	defer loopclosure.Analyzer.Flags.Set("escape-funcs", "")
+}
+
+func TestDeepFlag(t *testing.T) {
+	testdata := analysistest.TestData()
+	if err := loopclosure.Analyzer.Flags.Set("deep", "true"); err != nil {
+		t.Fatal(err)
+	}
+	defer loopclosure.Analyzer.Flags.Set("deep", "false")
+	analysistest.Run(t, testdata, loopclosure.Analyzer, "f")
+}
@@ -0,0 +1,135 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file contains tests for the loopclosure checker.
+
+package a
+
+import (
+	"context"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/singleflight"
+	"testing"
+)
+
+func _() {
+	var s []int
+	for i, v := range s {
+		go func() {
+			println(i) // want "loop variable i captured by func literal"
+			println(v) // want "loop variable v captured by func literal"
+		}()
+	}
+
+	for i, v := range s {
+		defer func() {
+			println(i) // want "loop variable i captured by func literal"
+			println(v) // want "loop variable v captured by func literal"
+		}()
+	}
+
+	var g errgroup.Group
+	for i, v := range s {
+		g.Go(func() error {
+			println(i) // want "loop variable i captured by func literal"
+			println(v) // want "loop variable v captured by func literal"
+			return nil
+		})
+	}
+
+	for i := range s {
+		// Capture before the final statement is not reported, since it is
+		// not (yet) known to escape the iteration.
+		go func() {
+			println(i)
+		}()
+		println("not the last statement")
+	}
+}
+
+func _() {
+	var s []int
+
+	var g errgroup.Group
+	for i, v := range s {
+		g.TryGo(func() error {
+			println(i) // want "loop variable i captured by func literal"
+			println(v) // want "loop variable v captured by func literal"
+			return nil
+		})
+	}
+
+	var sf singleflight.Group
+	for i, v := range s {
+		sf.Do("key", func() (interface{}, error) {
+			println(i) // want "loop variable i captured by func literal"
+			println(v) // want "loop variable v captured by func literal"
+			return nil, nil
+		})
+	}
+
+	for i, v := range s {
+		sf.DoChan("key", func() (interface{}, error) {
+			println(i) // want "loop variable i captured by func literal"
+			println(v) // want "loop variable v captured by func literal"
+			return nil, nil
+		})
+	}
+
+	ctx := context.Background()
+	for i, v := range s {
+		context.AfterFunc(ctx, func() {
+			println(i) // want "loop variable i captured by func literal"
+			println(v) // want "loop variable v captured by func literal"
+		})
+	}
+
+	for i, v := range s {
+		time.AfterFunc(time.Second, func() {
+			println(i) // want "loop variable i captured by func literal"
+			println(v) // want "loop variable v captured by func literal"
+		})
+	}
+}
+
+func _(t *testing.T) {
+	tests := []int{0, 1, 2}
+
+	// Capture after t.Parallel() is reported.
+	for _, tc := range tests {
+		t.Run("subtest", func(t *testing.T) {
+			t.Parallel()
+			println(tc) // want "loop variable tc captured by func literal"
+		})
+	}
+
+	// Capture before t.Parallel() is fine, since it runs synchronously.
+	for _, tc := range tests {
+		t.Run("subtest", func(t *testing.T) {
+			tc := tc
+			t.Parallel()
+			println(tc)
+		})
+	}
+
+	// No t.Parallel() at all: nothing escapes, so nothing is reported.
+	for _, tc := range tests {
+		t.Run("subtest", func(t *testing.T) {
+			println(tc)
+		})
+	}
+
+	// Nested t.Run: a capture in an inner subtest that runs after the outer
+	// t.Parallel() is reported.
+	for _, tc := range tests {
+		t.Run("outer", func(t *testing.T) {
+			t.Parallel()
+			t.Run("inner", func(t *testing.T) {
+				println(tc) // want "loop variable tc captured by func literal"
+			})
+		})
+	}
+}
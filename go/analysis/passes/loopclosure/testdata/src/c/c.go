@@ -0,0 +1,22 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file is analyzed with -escape-funcs=c.Pool.Submit:0 to verify that
+// user-supplied entries are recognized.
+package c
+
+type Pool struct{}
+
+func (*Pool) Submit(f func()) {}
+
+func _() {
+	var s []int
+	var p Pool
+	for i, v := range s {
+		p.Submit(func() {
+			println(i) // want "loop variable i captured by func literal"
+			println(v) // want "loop variable v captured by func literal"
+		})
+	}
+}
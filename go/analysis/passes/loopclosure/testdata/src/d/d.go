@@ -0,0 +1,40 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file is analyzed with analysistest.RunWithSuggestedFixes to check the
+// golden output of the loop variable rebinding fix.
+
+package d
+
+import "golang.org/x/sync/errgroup"
+
+func rangeLoop() {
+	var s []int
+	for i, v := range s {
+		go func() {
+			println(i) // want "loop variable i captured by func literal"
+			println(v) // want "loop variable v captured by func literal"
+		}()
+	}
+}
+
+func cStyleLoop() {
+	for i := 0; i < 10; i++ {
+		go func() {
+			println(i) // want "loop variable i captured by func literal"
+		}()
+	}
+}
+
+func errgroupLoop() {
+	var s []int
+	var g errgroup.Group
+	for i, v := range s {
+		g.Go(func() error {
+			println(i) // want "loop variable i captured by func literal"
+			println(v) // want "loop variable v captured by func literal"
+			return nil
+		})
+	}
+}
@@ -0,0 +1,21 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file is analyzed with analysistest.RunWithSuggestedFixes to check the
+// golden output of the loop variable rebinding fix for parallel subtests,
+// where the rebinding goes in the loop body rather than inside the closure.
+
+package e
+
+import "testing"
+
+func TestTable(t *testing.T) {
+	tests := []int{0, 1, 2}
+	for _, tc := range tests {
+		t.Run("subtest", func(t *testing.T) {
+			t.Parallel()
+			println(tc) // want "loop variable tc captured by func literal"
+		})
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file is analyzed with -deep to check the intra-loop dataflow pass.
+
+package f
+
+import (
+	"context"
+	"sync"
+
+	"golang.org/x/sync/errgroup"
+)
+
+func _() {
+	var s []int
+
+	// A goroutine launched mid-loop-body with no synchronization at all:
+	// flagged even though it isn't the last statement.
+	for i, v := range s {
+		go func() {
+			println(i) // want "loop variable i captured by func literal"
+			println(v) // want "loop variable v captured by func literal"
+		}()
+		println("not the last statement")
+	}
+
+	// A goroutine synchronized by a WaitGroup within the same loop body is
+	// effectively run synchronously, so the capture is safe.
+	var wg sync.WaitGroup
+	for i, v := range s {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			println(i)
+			println(v)
+		}()
+		wg.Wait()
+	}
+
+	// Here, wg.Wait() happens after the loop, so the goroutines from every
+	// iteration can still be running concurrently with later iterations:
+	// still flagged.
+	var wg2 sync.WaitGroup
+	for i, v := range s {
+		wg2.Add(1)
+		go func() {
+			defer wg2.Done()
+			println(i) // want "loop variable i captured by func literal"
+			println(v) // want "loop variable v captured by func literal"
+		}()
+	}
+	wg2.Wait()
+
+	// errgroup.Group.Go synchronized by g.Wait() within the same loop body.
+	var g errgroup.Group
+	for i, v := range s {
+		g.Go(func() error {
+			println(i)
+			println(v)
+			return nil
+		})
+		if err := g.Wait(); err != nil {
+			panic(err)
+		}
+	}
+
+	// A channel send synchronized by a receive in the same loop body.
+	ch := make(chan struct{})
+	for i, v := range s {
+		go func() {
+			println(i)
+			println(v)
+			ch <- struct{}{}
+		}()
+		<-ch
+	}
+
+	// A context.AfterFunc synchronized by calling its returned stop function
+	// within the same loop body is effectively run synchronously, so the
+	// capture is safe.
+	ctx := context.Background()
+	for i, v := range s {
+		stop := context.AfterFunc(ctx, func() {
+			println(i)
+			println(v)
+		})
+		stop()
+	}
+
+	// Here, the stop function returned by context.AfterFunc is never called,
+	// so the func passed to it may still run concurrently with later
+	// iterations: still flagged.
+	for i, v := range s {
+		context.AfterFunc(ctx, func() {
+			println(i) // want "loop variable i captured by func literal"
+			println(v) // want "loop variable v captured by func literal"
+		})
+		println("not the last statement")
+	}
+}
@@ -0,0 +1,29 @@
+// Package singleflight synthesizes Go's package
+// "golang.org/x/sync/singleflight", which is used in unit-testing.
+package singleflight
+
+// Result holds the results of Do, so they can be passed on a channel.
+type Result struct {
+	Val    interface{}
+	Err    error
+	Shared bool
+}
+
+type Group struct {
+}
+
+func (g *Group) Do(key string, fn func() (interface{}, error)) (v interface{}, err error, shared bool) {
+	go func() {
+		fn()
+	}()
+	return nil, nil, false
+}
+
+func (g *Group) DoChan(key string, fn func() (interface{}, error)) <-chan Result {
+	ch := make(chan Result, 1)
+	go func() {
+		v, err := fn()
+		ch <- Result{Val: v, Err: err}
+	}()
+	return ch
+}
@@ -0,0 +1,315 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package paralleltest defines an Analyzer that checks for missing
+// t.Parallel() calls, the inverse of the loopclosure check.
+package paralleltest
+
+import (
+	"go/ast"
+	"go/types"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/passes/inspect"
+	"golang.org/x/tools/go/analysis/passes/internal/analysisutil"
+	"golang.org/x/tools/go/ast/inspector"
+)
+
+const Doc = `check for missing uses of t.Parallel() methods
+
+This analyzer checks for three common mistakes that prevent Go tests from
+running in parallel:
+
+ 1. a top-level func TestXxx(t *testing.T) whose body never calls
+    t.Parallel();
+ 2. a table-driven test where t.Run is invoked inside a for/range loop over
+    the test cases, but the subtest function passed to t.Run never calls
+    t.Parallel(); and
+ 3. a table-driven test whose subtest does call t.Parallel(), but whose
+    closure captures the range loop variable without first reinitializing it
+    (e.g. "tc := tc"), which is the classic loopclosure bug made worse by
+    parallel execution.
+
+Pass -ignoremissing to only check for (3), the capture misuse, without
+requiring that every test and subtest call t.Parallel().`
+
+var ignoreMissing bool
+
+var Analyzer = &analysis.Analyzer{
+	Name:     "paralleltest",
+	Doc:      Doc,
+	Requires: []*analysis.Analyzer{inspect.Analyzer},
+	Run:      run,
+}
+
+func init() {
+	Analyzer.Flags.BoolVar(&ignoreMissing, "ignoremissing", false, "only check for range loop variable capture misuse, not missing t.Parallel() calls")
+}
+
+func run(pass *analysis.Pass) (interface{}, error) {
+	inspect := pass.ResultOf[inspect.Analyzer].(*inspector.Inspector)
+
+	nodeFilter := []ast.Node{(*ast.FuncDecl)(nil)}
+	inspect.Preorder(nodeFilter, func(n ast.Node) {
+		fn := n.(*ast.FuncDecl)
+		tParam := testingTParam(fn.Type)
+		if tParam == nil || !isTestName(fn.Name.Name) {
+			return
+		}
+
+		if !ignoreMissing && !callsParallel(pass.TypesInfo, fn.Body, tParam) {
+			pass.ReportRangef(fn, "Test %s does not call t.Parallel()", fn.Name.Name)
+		}
+
+		checkSubtests(pass, fn.Body)
+	})
+	return nil, nil
+}
+
+// checkSubtests looks for t.Run invocations inside for/range loops, which is
+// the shape of a table-driven test, and checks that each subtest both calls
+// t.Parallel() and correctly reinitializes any captured range variables.
+func checkSubtests(pass *analysis.Pass, body *ast.BlockStmt) {
+	ast.Inspect(body, func(n ast.Node) bool {
+		var loopVars []*ast.Ident
+		var loopBody *ast.BlockStmt
+		switch n := n.(type) {
+		case *ast.RangeStmt:
+			loopBody = n.Body
+			if id, ok := n.Key.(*ast.Ident); ok {
+				loopVars = append(loopVars, id)
+			}
+			if id, ok := n.Value.(*ast.Ident); ok {
+				loopVars = append(loopVars, id)
+			}
+		case *ast.ForStmt:
+			loopBody = n.Body
+		default:
+			return true
+		}
+
+		rebound := map[*ast.Object]bool{}
+		for _, stmt := range loopBody.List {
+			if ident, rhs, ok := selfRebind(stmt); ok {
+				if rhsIdent, ok := rhs.(*ast.Ident); ok && containsIdent(loopVars, rhsIdent) {
+					rebound[ident.Obj] = true
+				}
+			}
+
+			exprStmt, ok := stmt.(*ast.ExprStmt)
+			if !ok {
+				continue
+			}
+			call, ok := exprStmt.X.(*ast.CallExpr)
+			if !ok {
+				continue
+			}
+			lit := subtestFuncLit(pass.TypesInfo, call)
+			if lit == nil {
+				continue
+			}
+
+			tParam := testingTParam(lit.Type)
+			hasParallel := tParam != nil && callsParallel(pass.TypesInfo, lit.Body, tParam)
+			if tParam != nil && !ignoreMissing && !hasParallel {
+				pass.ReportRangef(call, "subtest does not call t.Parallel()")
+			}
+
+			// A subtest that never calls t.Parallel() runs synchronously, so
+			// it may safely reference the range variable without
+			// reinitializing it; the capture is only a bug once the subtest
+			// is actually parallelized.
+			if !hasParallel {
+				continue
+			}
+
+			// Only statements after t.Parallel() execute outside of the
+			// current loop iteration; a reference before it is as safe as
+			// the "tc := tc" idiom itself, matching how
+			// loopclosure.parallelSubtest treats the same call.
+			idx := parallelCallIndex(pass.TypesInfo, lit.Body)
+			captureStmts := lit.Body.List
+			reboundStmts := lit.Body.List
+			if idx >= 0 {
+				captureStmts = lit.Body.List[idx+1:]
+				reboundStmts = lit.Body.List[:idx+1]
+			}
+
+			for _, v := range loopVars {
+				// A rebind after t.Parallel() reads the already-shared
+				// variable at the wrong time and does not fix the race, so
+				// only a rebind at or before the t.Parallel() call counts.
+				if rebound[v.Obj] || reboundInBody(reboundStmts, v) {
+					continue
+				}
+				if ref := capturesStmts(pass.TypesInfo, captureStmts, v); ref != nil {
+					pass.ReportRangef(ref, "range variable %s captured by parallel subtest; reinitialize it (e.g. %s := %s) before t.Run", v.Name, v.Name, v.Name)
+				}
+			}
+		}
+		return true
+	})
+}
+
+// testingTParam returns the *testing.T parameter of fn, or nil if it has
+// none.
+func testingTParam(fn *ast.FuncType) *ast.Ident {
+	if fn.Params == nil {
+		return nil
+	}
+	for _, field := range fn.Params.List {
+		star, ok := field.Type.(*ast.StarExpr)
+		if !ok {
+			continue
+		}
+		sel, ok := star.X.(*ast.SelectorExpr)
+		if !ok || sel.Sel.Name != "T" {
+			continue
+		}
+		if len(field.Names) != 1 {
+			continue
+		}
+		return field.Names[0]
+	}
+	return nil
+}
+
+// isTestName reports whether name is a test function name recognized by
+// "go test": it must start with "Test", and if anything follows, it must
+// not start with a lowercase letter (go test runs TestFoo but not Testfoo).
+func isTestName(name string) bool {
+	if !strings.HasPrefix(name, "Test") {
+		return false
+	}
+	rest := name[len("Test"):]
+	if rest == "" {
+		return true
+	}
+	r, _ := utf8.DecodeRuneInString(rest)
+	return !unicode.IsLower(r)
+}
+
+// callsParallel reports whether body calls tParam.Parallel() anywhere.
+func callsParallel(info *types.Info, body *ast.BlockStmt, tParam *ast.Ident) bool {
+	found := false
+	ast.Inspect(body, func(n ast.Node) bool {
+		if found {
+			return false
+		}
+		exprStmt, ok := n.(*ast.ExprStmt)
+		if !ok {
+			return true
+		}
+		if analysisutil.IsMethodCall(info, exprStmt.X, "testing", "T", "Parallel") {
+			if sel, ok := exprStmt.X.(*ast.CallExpr).Fun.(*ast.SelectorExpr); ok {
+				if id, ok := sel.X.(*ast.Ident); ok && info.ObjectOf(id) == info.ObjectOf(tParam) {
+					found = true
+					return false
+				}
+			}
+		}
+		return true
+	})
+	return found
+}
+
+// subtestFuncLit returns the function literal argument of a t.Run(name, fn)
+// call, or nil if call is not such an invocation.
+func subtestFuncLit(info *types.Info, call *ast.CallExpr) *ast.FuncLit {
+	if !analysisutil.IsMethodCall(info, call, "testing", "T", "Run") {
+		return nil
+	}
+	if len(call.Args) != 2 {
+		return nil
+	}
+	lit, ok := call.Args[1].(*ast.FuncLit)
+	if !ok {
+		return nil
+	}
+	return lit
+}
+
+// selfRebind reports whether stmt is a short variable declaration of a
+// single variable, "x := expr", returning the new identifier and the
+// right-hand expression. It does not check that expr is x; callers do.
+func selfRebind(stmt ast.Stmt) (ident *ast.Ident, rhs ast.Expr, ok bool) {
+	assign, ok := stmt.(*ast.AssignStmt)
+	if !ok || assign.Tok.String() != ":=" || len(assign.Lhs) != 1 || len(assign.Rhs) != 1 {
+		return nil, nil, false
+	}
+	id, ok := assign.Lhs[0].(*ast.Ident)
+	if !ok {
+		return nil, nil, false
+	}
+	return id, assign.Rhs[0], true
+}
+
+// reboundInBody reports whether stmts contains a "v := v" rebinding of v.
+func reboundInBody(stmts []ast.Stmt, v *ast.Ident) bool {
+	for _, stmt := range stmts {
+		if ident, rhs, ok := selfRebind(stmt); ok {
+			if rhsIdent, ok := rhs.(*ast.Ident); ok && rhsIdent.Obj == v.Obj && ident.Name == v.Name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// parallelCallIndex returns the index within body.List of the top-level
+// statement that calls t.Parallel(), or -1 if there is none. This mirrors
+// loopclosure.parallelSubtest's index-based handling of the same call.
+func parallelCallIndex(info *types.Info, body *ast.BlockStmt) int {
+	for i, stmt := range body.List {
+		exprStmt, ok := stmt.(*ast.ExprStmt)
+		if !ok {
+			continue
+		}
+		if analysisutil.IsMethodCall(info, exprStmt.X, "testing", "T", "Parallel") {
+			return i
+		}
+	}
+	return -1
+}
+
+// capturesStmts returns the first reference to v in stmts, or nil if there
+// is none.
+func capturesStmts(info *types.Info, stmts []ast.Stmt, v *ast.Ident) *ast.Ident {
+	for _, stmt := range stmts {
+		var found *ast.Ident
+		ast.Inspect(stmt, func(n ast.Node) bool {
+			if found != nil {
+				return false
+			}
+			id, ok := n.(*ast.Ident)
+			if !ok || id.Obj == nil {
+				return true
+			}
+			if info.Types[id].Type == nil {
+				return true
+			}
+			if id.Obj == v.Obj {
+				found = id
+				return false
+			}
+			return true
+		})
+		if found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func containsIdent(idents []*ast.Ident, id *ast.Ident) bool {
+	for _, i := range idents {
+		if i.Obj == id.Obj {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,26 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package paralleltest_test
+
+import (
+	"testing"
+
+	"golang.org/x/tools/go/analysis/analysistest"
+	"golang.org/x/tools/go/analysis/passes/paralleltest"
+)
+
+func Test(t *testing.T) {
+	testdata := analysistest.TestData()
+	analysistest.Run(t, testdata, paralleltest.Analyzer, "a")
+}
+
+func TestIgnoreMissing(t *testing.T) {
+	testdata := analysistest.TestData()
+	if err := paralleltest.Analyzer.Flags.Set("ignoremissing", "true"); err != nil {
+		t.Fatal(err)
+	}
+	defer paralleltest.Analyzer.Flags.Set("ignoremissing", "false")
+	analysistest.Run(t, testdata, paralleltest.Analyzer, "b")
+}
@@ -0,0 +1,108 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package a
+
+import "testing"
+
+// A top-level test that never calls t.Parallel().
+func TestMissingParallel(t *testing.T) { // want "Test TestMissingParallel does not call t.Parallel\\(\\)"
+	println("no parallel here")
+}
+
+// A top-level test that correctly calls t.Parallel().
+func TestHasParallel(t *testing.T) {
+	t.Parallel()
+}
+
+// Not a test function by go test's rules (the rune after "Test" is
+// lowercase), so it is never flagged for missing t.Parallel().
+func Testfoo(t *testing.T) {
+	println("not actually run by go test")
+}
+
+var cases = []struct {
+	name string
+	val  int
+}{
+	{"a", 1},
+	{"b", 2},
+}
+
+// A table-driven test whose subtest never calls t.Parallel().
+func TestTableMissingSubtestParallel(t *testing.T) {
+	t.Parallel()
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) { // want "subtest does not call t.Parallel\\(\\)"
+			println(tc.val)
+		})
+	}
+}
+
+// A table-driven test whose subtest calls t.Parallel() but captures the
+// range variable without reinitializing it first.
+func TestTableCapturesLoopVar(t *testing.T) {
+	t.Parallel()
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			println(tc.val) // want "range variable tc captured by parallel subtest; reinitialize it \\(e.g. tc := tc\\) before t.Run"
+		})
+	}
+}
+
+// A table-driven test whose subtest never calls t.Parallel() at all: it runs
+// synchronously, so referencing the range variable without reinitializing it
+// is safe and must not be flagged as case (3), only as missing t.Parallel().
+func TestTableNonParallelCapturesLoopVar(t *testing.T) {
+	t.Parallel()
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) { // want "subtest does not call t.Parallel\\(\\)"
+			println(tc.val)
+		})
+	}
+}
+
+// A table-driven test whose subtest references the range variable before
+// calling t.Parallel(): this is as safe as the "tc := tc" idiom, since the
+// reference executes synchronously with the loop.
+func TestTableCaptureBeforeParallel(t *testing.T) {
+	t.Parallel()
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			val := tc.val
+			t.Parallel()
+			println(val)
+		})
+	}
+}
+
+// A table-driven test whose subtest rebinds tc, but only after calling
+// t.Parallel(): by then the closure has already read the shared loop
+// variable, so the rebind comes too late to fix anything and the capture
+// must still be flagged.
+func TestTableRebindAfterParallel(t *testing.T) {
+	t.Parallel()
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			tc := tc // want "range variable tc captured by parallel subtest; reinitialize it \\(e.g. tc := tc\\) before t.Run"
+			println(tc.val)
+		})
+	}
+}
+
+// A correctly written table-driven test: rebinds tc before t.Run and calls
+// t.Parallel() in the subtest.
+func TestTableCorrect(t *testing.T) {
+	t.Parallel()
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			println(tc.val)
+		})
+	}
+}
@@ -0,0 +1,48 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package b is analyzed with -ignoremissing, so only loop variable capture
+// misuse (3) is reported, not missing t.Parallel() calls (1) and (2).
+package b
+
+import "testing"
+
+func TestMissingParallel(t *testing.T) {
+	println("not flagged with -ignoremissing")
+}
+
+var cases = []struct {
+	name string
+	val  int
+}{
+	{"a", 1},
+}
+
+func TestTableMissingSubtestParallel(t *testing.T) {
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			println(tc.val) // not flagged: -ignoremissing suppresses (2)
+		})
+	}
+}
+
+func TestTableCapturesLoopVar(t *testing.T) {
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			println(tc.val) // want "range variable tc captured by parallel subtest; reinitialize it \\(e.g. tc := tc\\) before t.Run"
+		})
+	}
+}
+
+// A non-parallel subtest capturing tc without a rebind is never flagged,
+// even with -ignoremissing, since it runs synchronously.
+func TestTableNonParallelCapturesLoopVar(t *testing.T) {
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			println(tc.val)
+		})
+	}
+}